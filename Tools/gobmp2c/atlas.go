@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// atlasMagic identifies the -atlas stream: magic, entry count, one
+// directory entry per sprite (name length, name, offset, length, width,
+// height), then the concatenated per-sprite streams (offsets are relative
+// to the start of that concatenated body, i.e. right after the directory).
+const atlasMagic = uint16(0x4154) // "AT"
+
+type atlasEntry struct {
+	name   string
+	offset uint32
+	length uint32
+	width  uint16
+	height uint16
+}
+
+// writeAtlas packs files into a single indexed sprite atlas on stdout, so
+// firmware can DMA one blob out of flash and look sprites up by index
+// instead of linking in a separate extern symbol per icon. Each file is
+// encoded with format (rle16 or packbits), same as -binary. If headerPath
+// is non-empty, a matching C header of #define indices is also written
+// there.
+func writeAtlas(files []string, format, headerPath string) error {
+	entries := make([]atlasEntry, 0, len(files))
+	var body bytes.Buffer
+
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		b, err := decodeImage(f, file)
+		f.Close()
+		if err != nil {
+			return err
+		}
+
+		var sprite bytes.Buffer
+		binOut = &sprite
+		switch format {
+		case "packbits":
+			writePackBits(b)
+		case "rle16":
+			writeRLE16(b)
+		default:
+			binOut = nil
+			return fmt.Errorf("unknown -format %q, want rle16 or packbits", format)
+		}
+		binOut = nil
+
+		entries = append(entries, atlasEntry{
+			name:   strings.TrimSuffix(file, "_30h.bmp"),
+			offset: uint32(body.Len()),
+			length: uint32(sprite.Len()),
+			width:  uint16(b.Bounds().Dx()),
+			height: uint16(b.Bounds().Dy()),
+		})
+		body.Write(sprite.Bytes())
+	}
+
+	writeBinary(atlasMagic)
+	writeBinary(uint16(len(entries)))
+	for _, e := range entries {
+		writeBinary(uint8(len(e.name)))
+		writeBinary([]byte(e.name))
+		writeBinary(e.offset)
+		writeBinary(e.length)
+		writeBinary(e.width)
+		writeBinary(e.height)
+	}
+	if _, err := os.Stdout.Write(body.Bytes()); err != nil {
+		return err
+	}
+
+	if headerPath == "" {
+		return nil
+	}
+	return writeAtlasHeader(headerPath, entries)
+}
+
+// writeAtlasHeader emits one #define per sprite index into atlas_data,
+// analogous to the extern const uint8_t name[] the non-atlas text mode
+// emits per file.
+func writeAtlasHeader(path string, entries []atlasEntry) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	fmt.Fprintln(out, "// Generated by gobmp2c -atlas. Look sprites up by index in atlas_data.")
+	fmt.Fprintln(out, "extern const uint8_t atlas_data[];")
+	fmt.Fprintln(out)
+	for i, e := range entries {
+		fmt.Fprintf(out, "#define ATLAS_%s_INDEX %d\n", atlasIdent(e.name), i)
+	}
+	return nil
+}
+
+// atlasIdent turns a sprite name into a valid, conventionally-uppercase C
+// identifier fragment.
+func atlasIdent(name string) string {
+	var sb strings.Builder
+	for _, r := range name {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			sb.WriteRune(unicode.ToUpper(r))
+		} else {
+			sb.WriteByte('_')
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"io"
+	"path/filepath"
+	"testing"
+)
+
+func TestAtlasRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+
+	img1 := syntheticTestImage()
+	img2 := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 2; x++ {
+			img2.Set(x, y, color.RGBA{R: 0xf8, G: 0xfc, B: 0xf8, A: 0xff})
+		}
+	}
+
+	path1 := filepath.Join(dir, "icon_a_30h.bmp")
+	path2 := filepath.Join(dir, "icon_b_30h.bmp")
+	if err := writeImageFile(path1, img1); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeImageFile(path2, img2); err != nil {
+		t.Fatal(err)
+	}
+	headerPath := filepath.Join(dir, "atlas.h")
+
+	data := captureStdout(t, func() {
+		if err := writeAtlas([]string{path1, path2}, "rle16", headerPath); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	r := bytes.NewReader(data)
+	var magic, count uint16
+	if err := binary.Read(r, binary.LittleEndian, &magic); err != nil {
+		t.Fatal(err)
+	}
+	if magic != atlasMagic {
+		t.Fatalf("magic = %x, want %x", magic, atlasMagic)
+	}
+	if err := binary.Read(r, binary.LittleEndian, &count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Fatalf("count = %d, want 2", count)
+	}
+
+	entries := make([]atlasEntry, count)
+	for i := range entries {
+		var nameLen uint8
+		if err := binary.Read(r, binary.LittleEndian, &nameLen); err != nil {
+			t.Fatal(err)
+		}
+		name := make([]byte, nameLen)
+		if _, err := io.ReadFull(r, name); err != nil {
+			t.Fatal(err)
+		}
+		var e atlasEntry
+		e.name = string(name)
+		binary.Read(r, binary.LittleEndian, &e.offset)
+		binary.Read(r, binary.LittleEndian, &e.length)
+		binary.Read(r, binary.LittleEndian, &e.width)
+		binary.Read(r, binary.LittleEndian, &e.height)
+		entries[i] = e
+	}
+
+	wantNames := []string{"icon_a", "icon_b"}
+	wantDims := [][2]uint16{{4, 3}, {2, 2}}
+	for i, e := range entries {
+		if got := filepath.Base(e.name); got != wantNames[i] {
+			t.Errorf("entries[%d].name = %q, want suffix %q", i, e.name, wantNames[i])
+		}
+		if e.width != wantDims[i][0] || e.height != wantDims[i][1] {
+			t.Errorf("entries[%d] dims = %dx%d, want %dx%d", i, e.width, e.height, wantDims[i][0], wantDims[i][1])
+		}
+	}
+
+	body, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, img := range []image.Image{img1, img2} {
+		want := captureStdout(t, func() { writeRLE16(img) })
+		e := entries[i]
+		got := body[e.offset : e.offset+e.length]
+		if !bytes.Equal(got, want) {
+			t.Errorf("entries[%d] body mismatch: got %v, want %v", i, got, want)
+		}
+	}
+}
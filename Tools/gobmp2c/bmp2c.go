@@ -4,8 +4,14 @@ import (
 	"encoding/binary"
 	"flag"
 	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
 	"math"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"golang.org/x/image/bmp"
@@ -13,11 +19,42 @@ import (
 
 func main() {
 	var binaryOutput bool
+	var paletteOutput bool
+	var paletteFile string
+	var paletteColors int
+	var format string
+	var decodeMode bool
+	var atlasOutput bool
+	var atlasHeader string
 	flag.BoolVar(&binaryOutput, "binary", false, "Binary output")
+	flag.BoolVar(&paletteOutput, "palette", false, "Palette-indexed binary output")
+	flag.StringVar(&paletteFile, "palette-file", "", "Palette file (JSON or one #RRGGBB per line); derived by median-cut quantization if unset")
+	flag.IntVar(&paletteColors, "palette-colors", 16, "Maximum number of colors when deriving a palette (ignored with -palette-file)")
+	flag.StringVar(&format, "format", "rle16", "Binary encoding for -binary/-decode/-atlas: rle16 (legacy pair RLE) or packbits (see packbits.h)")
+	flag.BoolVar(&decodeMode, "decode", false, "Reverse mode: read a -binary stream and write it back out as an image (input.bin output.bmp|.png)")
+	flag.BoolVar(&atlasOutput, "atlas", false, "Pack all input files into a single indexed sprite atlas instead of one output per file")
+	flag.StringVar(&atlasHeader, "atlas-header", "", "Path to also write a C header of #define sprite indices for -atlas")
 	flag.Parse()
 
 	files := flag.Args()
 
+	if decodeMode {
+		if len(files) != 2 {
+			panic("-decode wants exactly two arguments: input.bin output.bmp|.png")
+		}
+		if err := decodeBinaryFile(files[0], files[1], format); err != nil {
+			panic(err)
+		}
+		return
+	}
+
+	if atlasOutput {
+		if err := writeAtlas(files, format, atlasHeader); err != nil {
+			panic(err)
+		}
+		return
+	}
+
 	for _, file := range files {
 		f, err := os.Open(file)
 		if err != nil {
@@ -25,34 +62,25 @@ func main() {
 		}
 		defer f.Close()
 
-		b, err := bmp.Decode(f)
+		b, err := decodeImage(f, file)
 		if err != nil {
 			panic(err)
 		}
 
-		if binaryOutput {
-			writeBinary(uint16(b.Bounds().Max.X))
-			writeBinary(uint16(b.Bounds().Max.Y))
-
-			repeatCount := uint32(0)
-			lastData := uint16(0)
-			for y := b.Bounds().Max.Y; y >= b.Bounds().Min.Y; {
-				y--
-				for x := b.Bounds().Min.X; x < b.Bounds().Max.X; x++ {
-					c := b.At(x, y)
-					oc := convertTo16BitColor(c.RGBA())
-					if repeatCount > 0 && (lastData != oc || repeatCount == math.MaxUint16) {
-						writeBinary(repeatCount - 1)
-						writeBinary(lastData)
-					}
-					lastData = oc
-					repeatCount++
-					// Last pixel
-					if x+1 == b.Bounds().Max.X && y == 0 {
-						writeBinary(repeatCount - 1)
-						writeBinary(lastData)
-					}
-				}
+		if paletteOutput {
+			palette, err := loadOrDerivePalette(paletteFile, b, paletteColors)
+			if err != nil {
+				panic(err)
+			}
+			writePaletteBinary(b, palette)
+		} else if binaryOutput {
+			switch format {
+			case "packbits":
+				writePackBits(b)
+			case "rle16":
+				writeRLE16(b)
+			default:
+				panic(fmt.Sprintf("unknown -format %q, want rle16 or packbits", format))
 			}
 		} else {
 			start := true
@@ -78,6 +106,62 @@ func main() {
 	}
 }
 
+// decodeImage picks a decoder for f based on the file extension, falling
+// back to format sniffing via image.Decode (and finally bmp.Decode, which
+// doesn't register itself with the image package) so art can be authored
+// as BMP, PNG, GIF, or JPEG.
+func decodeImage(f *os.File, name string) (image.Image, error) {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".bmp":
+		return bmp.Decode(f)
+	case ".png", ".jpg", ".jpeg", ".gif":
+		img, _, err := image.Decode(f)
+		return img, err
+	}
+
+	img, _, err := image.Decode(f)
+	if err == nil {
+		return img, nil
+	}
+
+	if _, serr := f.Seek(0, io.SeekStart); serr != nil {
+		return nil, err
+	}
+	return bmp.Decode(f)
+}
+
+// writeRLE16 is the legacy -format=rle16 encoder: width, height, then a
+// (count, pixel) pair whenever the pixel value changes. repeatCount is
+// never reset between pairs, so count is a cumulative pixel boundary
+// (count+1 pixels decoded so far), not that run's length in isolation; see
+// decodeRLE16Stream. Kept byte-for-byte identical to the original -binary
+// output so existing firmware decoders keep working.
+func writeRLE16(b image.Image) {
+	writeBinary(uint16(b.Bounds().Max.X))
+	writeBinary(uint16(b.Bounds().Max.Y))
+
+	repeatCount := uint32(0)
+	lastData := uint16(0)
+	for y := b.Bounds().Max.Y; y >= b.Bounds().Min.Y; {
+		y--
+		for x := b.Bounds().Min.X; x < b.Bounds().Max.X; x++ {
+			c := b.At(x, y)
+			oc := convertTo16BitColor(c.RGBA())
+			if repeatCount > 0 && (lastData != oc || repeatCount == math.MaxUint16) {
+				writeBinary(repeatCount - 1)
+				writeBinary(lastData)
+			}
+			lastData = oc
+			repeatCount++
+			// Last pixel
+			if x+1 == b.Bounds().Max.X && y == 0 {
+				writeBinary(repeatCount - 1)
+				writeBinary(lastData)
+			}
+		}
+	}
+}
+
 func getPaletteIndex(r, g, b, a uint32) int {
 	if r == 0xffff && g == 0xffff && b == 0xffff {
 		return 1
@@ -96,6 +180,15 @@ func convertTo16BitColor(r, g, b, a uint32) uint16 {
 	return result
 }
 
+// binOut, when set, is where writeBinary sends encoded bitmap data instead
+// of stdout. writeAtlas temporarily points it at a buffer so each packed
+// sprite's stream can be captured before being concatenated into the atlas
+// body.
+var binOut io.Writer
+
 func writeBinary(data interface{}) error {
+	if binOut != nil {
+		return binary.Write(binOut, binary.LittleEndian, data)
+	}
 	return binary.Write(os.Stdout, binary.LittleEndian, data)
 }
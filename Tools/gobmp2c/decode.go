@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/image/bmp"
+)
+
+// decodeBinaryFile reads a -binary stream (in the given format) from inPath
+// and writes it back out as a BMP or PNG, chosen by outPath's extension.
+// This is the inverse of writeRLE16/writePackBits, so a golden-file test can
+// round-trip an image through the encoder and compare pixel-for-pixel.
+func decodeBinaryFile(inPath, outPath, format string) error {
+	f, err := os.Open(inPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	img, err := decodeBinaryStream(bufio.NewReader(f), format)
+	if err != nil {
+		return fmt.Errorf("decoding %s: %w", inPath, err)
+	}
+
+	return writeImageFile(outPath, img)
+}
+
+func decodeBinaryStream(r io.Reader, format string) (*image.RGBA, error) {
+	var width, height uint16
+	if err := binary.Read(r, binary.LittleEndian, &width); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(r, binary.LittleEndian, &height); err != nil {
+		return nil, err
+	}
+
+	var pixels []uint16
+	var err error
+	switch format {
+	case "packbits":
+		pixels, err = decodePackBitsStream(r, int(width)*int(height))
+	case "rle16":
+		pixels, err = decodeRLE16Stream(r, int(width)*int(height))
+	default:
+		return nil, fmt.Errorf("unknown -format %q, want rle16 or packbits", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return pixelsToImage(pixels, int(width), int(height)), nil
+}
+
+// decodeRLE16Stream is the inverse of writeRLE16. Each record is a uint32
+// cumulative pixel boundary (count) followed by a uint16 pixel: count+1 is
+// the total number of pixels decoded once this record is applied, so the
+// record fills every pixel from the previous boundary up to there with px.
+// writeRLE16's repeatCount never resets between records, so count is a
+// running total rather than a per-run length; the delta between
+// consecutive boundaries is what recovers the run length.
+func decodeRLE16Stream(r io.Reader, n int) ([]uint16, error) {
+	pixels := make([]uint16, 0, n)
+	for len(pixels) < n {
+		var count uint32
+		var px uint16
+		if err := binary.Read(r, binary.LittleEndian, &count); err != nil {
+			return nil, err
+		}
+		if err := binary.Read(r, binary.LittleEndian, &px); err != nil {
+			return nil, err
+		}
+		target := int(count) + 1
+		for len(pixels) < target {
+			pixels = append(pixels, px)
+		}
+	}
+	return pixels, nil
+}
+
+// decodePackBitsStream is the inverse of writePackBits: a signed 16-bit run
+// header, negative for a literal run, non-negative for a replicate run.
+func decodePackBitsStream(r io.Reader, n int) ([]uint16, error) {
+	pixels := make([]uint16, 0, n)
+	for len(pixels) < n {
+		var header int16
+		if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+			return nil, err
+		}
+		if header < 0 {
+			for i := 0; i < -int(header); i++ {
+				var px uint16
+				if err := binary.Read(r, binary.LittleEndian, &px); err != nil {
+					return nil, err
+				}
+				pixels = append(pixels, px)
+			}
+		} else {
+			var px uint16
+			if err := binary.Read(r, binary.LittleEndian, &px); err != nil {
+				return nil, err
+			}
+			for i := 0; i <= int(header); i++ {
+				pixels = append(pixels, px)
+			}
+		}
+	}
+	return pixels, nil
+}
+
+// pixelsToImage rebuilds an image.RGBA from a pixel stream laid out bottom
+// row first, left to right within a row (the order writeRLE16/writePackBits
+// read images in).
+func pixelsToImage(pixels []uint16, width, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for i, px := range pixels {
+		row, col := i/width, i%width
+		img.Set(col, height-1-row, rgb565ToColor(px))
+	}
+	return img
+}
+
+// rgb565ToColor is the inverse of convertTo16BitColor.
+func rgb565ToColor(c uint16) color.RGBA {
+	r := uint8(c>>11&0x1f) << 3
+	g := uint8(c>>5&0x3f) << 2
+	b := uint8(c&0x1f) << 3
+	return color.RGBA{R: r, G: g, B: b, A: 0xff}
+}
+
+func writeImageFile(path string, img image.Image) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".bmp":
+		return bmp.Encode(out, img)
+	case ".png":
+		return png.Encode(out, img)
+	default:
+		return fmt.Errorf("unsupported output extension %q, want .bmp or .png", filepath.Ext(path))
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"io"
+	"os"
+	"testing"
+)
+
+// syntheticTestImage returns a small image whose colors already sit on the
+// RGB565 grid, so converting to RGB565 and back is lossless and a golden
+// round trip can compare pixels exactly.
+func syntheticTestImage() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 3))
+	colors := []color.RGBA{
+		{R: 0, G: 0, B: 0, A: 0xff},
+		{R: 0xf8, G: 0xfc, B: 0xf8, A: 0xff},
+		{R: 0x08, G: 0x04, B: 0x08, A: 0xff},
+	}
+	for y := 0; y < img.Bounds().Dy(); y++ {
+		for x := 0; x < img.Bounds().Dx(); x++ {
+			img.Set(x, y, colors[(x+y)%len(colors)])
+		}
+	}
+	return img
+}
+
+func captureStdout(t *testing.T, f func()) []byte {
+	t.Helper()
+	old := os.Stdout
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stdout = w
+	f()
+	w.Close()
+	os.Stdout = old
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func assertPixelsMatch(t *testing.T, want *image.RGBA, got *image.RGBA) {
+	t.Helper()
+	if got.Bounds() != want.Bounds() {
+		t.Fatalf("bounds mismatch: got %v, want %v", got.Bounds(), want.Bounds())
+	}
+	for y := want.Bounds().Min.Y; y < want.Bounds().Max.Y; y++ {
+		for x := want.Bounds().Min.X; x < want.Bounds().Max.X; x++ {
+			if got.RGBAAt(x, y) != want.RGBAAt(x, y) {
+				t.Fatalf("pixel (%d,%d) mismatch: got %v, want %v", x, y, got.RGBAAt(x, y), want.RGBAAt(x, y))
+			}
+		}
+	}
+}
+
+func TestRLE16RoundTrip(t *testing.T) {
+	src := syntheticTestImage()
+	data := captureStdout(t, func() { writeRLE16(src) })
+
+	got, err := decodeBinaryStream(bytes.NewReader(data), "rle16")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertPixelsMatch(t, src, got)
+}
+
+func TestPackBitsRoundTrip(t *testing.T) {
+	src := syntheticTestImage()
+	data := captureStdout(t, func() { writePackBits(src) })
+
+	got, err := decodeBinaryStream(bytes.NewReader(data), "packbits")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertPixelsMatch(t, src, got)
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"image"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// paletteMagic identifies the -palette binary stream: header, then N×RGB565
+// palette entries, then packed pixel indices (bottom-to-top, left-to-right,
+// matching the -binary mode's row order). See palette.h for the full
+// decoder contract.
+const paletteMagic = uint16(0x5042) // "PB"
+
+// loadOrDerivePalette reads a palette from file (JSON array of "#RRGGBB"
+// strings, or one per line) if given, otherwise derives one from img via
+// median-cut quantization, capped at maxColors (and at 255, the largest
+// length the binary format's one-byte palette length field can describe).
+func loadOrDerivePalette(file string, img image.Image, maxColors int) ([]uint16, error) {
+	if maxColors <= 0 || maxColors > 255 {
+		maxColors = 255
+	}
+	if file == "" {
+		return quantizePalette(img, maxColors), nil
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var hexColors []string
+	if strings.HasSuffix(strings.ToLower(file), ".json") {
+		if err := json.Unmarshal(data, &hexColors); err != nil {
+			return nil, fmt.Errorf("parsing palette JSON %s: %w", file, err)
+		}
+	} else {
+		scanner := bufio.NewScanner(strings.NewReader(string(data)))
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" {
+				continue
+			}
+			hexColors = append(hexColors, line)
+		}
+	}
+
+	palette := make([]uint16, 0, len(hexColors))
+	for _, hc := range hexColors {
+		r, g, b, err := parseHexColor(hc)
+		if err != nil {
+			return nil, fmt.Errorf("palette file %s: %w", file, err)
+		}
+		palette = append(palette, convertTo16BitColor(r, g, b, 0))
+	}
+	if len(palette) == 0 {
+		return nil, fmt.Errorf("palette file %s: no colors", file)
+	}
+	if len(palette) > 255 {
+		return nil, fmt.Errorf("palette file %s: %d colors exceeds the 255 entry limit", file, len(palette))
+	}
+	return palette, nil
+}
+
+func parseHexColor(s string) (r, g, b uint32, err error) {
+	s = strings.TrimPrefix(s, "#")
+	if len(s) != 6 {
+		return 0, 0, 0, fmt.Errorf("invalid color %q, want #RRGGBB", s)
+	}
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("invalid color %q: %w", s, err)
+	}
+	// Widen 8-bit channels back to the 0-0xffff range image.Color uses.
+	r = uint32(v>>16&0xff) * 0x101
+	g = uint32(v>>8&0xff) * 0x101
+	b = uint32(v&0xff) * 0x101
+	return r, g, b, nil
+}
+
+// quantizePalette derives a palette of at most maxColors entries from img
+// using median-cut: the pixel RGB565 values are repeatedly split, along the
+// channel with the widest range, into buckets that are each averaged down
+// to one color.
+func quantizePalette(img image.Image, maxColors int) []uint16 {
+	bounds := img.Bounds()
+	pixels := make([][3]int, 0, bounds.Dx()*bounds.Dy())
+	seen := make(map[uint16]bool)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, _ := img.At(x, y).RGBA()
+			oc := convertTo16BitColor(r, g, b, 0)
+			if seen[oc] {
+				continue
+			}
+			seen[oc] = true
+			pixels = append(pixels, [3]int{int(r >> 8), int(g >> 8), int(b >> 8)})
+		}
+	}
+	if len(pixels) == 0 {
+		return []uint16{0}
+	}
+
+	buckets := [][][3]int{pixels}
+	for len(buckets) < maxColors {
+		splitIdx, widestChannel, widest := -1, 0, -1
+		for i, bucket := range buckets {
+			if len(bucket) < 2 {
+				continue
+			}
+			channel, r := widestRange(bucket)
+			if r > widest {
+				splitIdx, widestChannel, widest = i, channel, r
+			}
+		}
+		if splitIdx < 0 {
+			break
+		}
+
+		bucket := buckets[splitIdx]
+		sort.Slice(bucket, func(a, b int) bool { return bucket[a][widestChannel] < bucket[b][widestChannel] })
+		mid := len(bucket) / 2
+
+		buckets[splitIdx] = bucket[:mid]
+		buckets = append(buckets, bucket[mid:])
+	}
+
+	palette := make([]uint16, len(buckets))
+	for i, bucket := range buckets {
+		var r, g, b int
+		for _, p := range bucket {
+			r += p[0]
+			g += p[1]
+			b += p[2]
+		}
+		n := len(bucket)
+		avg := uint32(r/n)<<8 | uint32(r/n)
+		avgG := uint32(g/n)<<8 | uint32(g/n)
+		avgB := uint32(b/n)<<8 | uint32(b/n)
+		palette[i] = convertTo16BitColor(avg, avgG, avgB, 0)
+	}
+	return palette
+}
+
+func widestRange(bucket [][3]int) (channel, spread int) {
+	min := [3]int{256, 256, 256}
+	max := [3]int{-1, -1, -1}
+	for _, p := range bucket {
+		for c := 0; c < 3; c++ {
+			if p[c] < min[c] {
+				min[c] = p[c]
+			}
+			if p[c] > max[c] {
+				max[c] = p[c]
+			}
+		}
+	}
+	for c := 0; c < 3; c++ {
+		if max[c]-min[c] > spread {
+			spread, channel = max[c]-min[c], c
+		}
+	}
+	return channel, spread
+}
+
+// nearestPaletteIndex returns the index of the palette entry closest to oc
+// in RGB565 space.
+func nearestPaletteIndex(oc uint16, palette []uint16) int {
+	best, bestDist := 0, -1
+	or, og, ob := oc>>11&0x1f, oc>>5&0x3f, oc&0x1f
+	for i, pc := range palette {
+		pr, pg, pb := pc>>11&0x1f, pc>>5&0x3f, pc&0x1f
+		dr, dg, db := int(or)-int(pr), int(og)-int(pg), int(ob)-int(pb)
+		dist := dr*dr + dg*dg + db*db
+		if bestDist < 0 || dist < bestDist {
+			best, bestDist = i, dist
+		}
+	}
+	return best
+}
+
+// bitsPerIndex returns the smallest power-of-two pixel width (1, 2, 4, or 8)
+// that can represent paletteLen distinct indices.
+func bitsPerIndex(paletteLen int) int {
+	for _, bits := range []int{1, 2, 4, 8} {
+		if paletteLen <= 1<<uint(bits) {
+			return bits
+		}
+	}
+	return 8
+}
+
+// writePaletteBinary emits the -palette stream: magic, width, height,
+// palette length, the palette itself as RGB565 entries, then the image
+// packed to bitsPerIndex(len(palette)) bits per pixel, most-significant
+// bit first, one row at a time bottom-to-top. Each row is flushed to a
+// byte boundary before the next one starts (see palette.h), so a row never
+// straddles a partial byte from the row before it.
+func writePaletteBinary(img image.Image, palette []uint16) {
+	bounds := img.Bounds()
+	writeBinary(paletteMagic)
+	writeBinary(uint16(bounds.Dx()))
+	writeBinary(uint16(bounds.Dy()))
+	writeBinary(uint8(len(palette)))
+	for _, c := range palette {
+		writeBinary(c)
+	}
+
+	bits := bitsPerIndex(len(palette))
+	for y := bounds.Max.Y; y > bounds.Min.Y; {
+		y--
+		var cur byte
+		var filled int
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, _ := img.At(x, y).RGBA()
+			idx := nearestPaletteIndex(convertTo16BitColor(r, g, b, 0), palette)
+			cur = cur<<uint(bits) | byte(idx)
+			filled += bits
+			if filled == 8 {
+				writeBinary(cur)
+				cur, filled = 0, 0
+			}
+		}
+		if filled > 0 {
+			cur <<= uint(8 - filled)
+			writeBinary(cur)
+		}
+	}
+}